@@ -0,0 +1,232 @@
+package godocker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+)
+
+const defaultRegistryHost = "index.docker.io"
+
+// RegistryAuth is one set of credentials for a single registry host, as
+// supplied via Configs.Auths.
+type RegistryAuth struct {
+	Host     string
+	Username string
+	Password string
+}
+
+// AuthResolver resolves the credentials to use for a given image reference.
+// The default implementation also understands docker's config.json
+// credHelpers/credsStore entries.
+type AuthResolver interface {
+	// Resolve returns the AuthConfig for the registry host that imagePath
+	// refers to. It returns the zero value, ok=false if no credentials are
+	// known for that host.
+	Resolve(imagePath string) (auth types.AuthConfig, ok bool)
+	// All returns every known credential, keyed by registry host, for use
+	// as the AuthConfigs map passed to a multi-stage build.
+	All() map[string]types.AuthConfig
+}
+
+type authResolver struct {
+	byHost map[string]types.AuthConfig
+}
+
+// newAuthResolver builds an AuthResolver from the explicit entries in
+// cfg.Auths plus whatever is found in $DOCKER_CONFIG/config.json (or
+// ~/.docker/config.json), including credHelpers and credsStore entries.
+func newAuthResolver(cfg Configs) *authResolver {
+	byHost := make(map[string]types.AuthConfig)
+
+	for _, a := range cfg.Auths {
+		byHost[a.Host] = types.AuthConfig{
+			ServerAddress: a.Host,
+			Username:      a.Username,
+			Password:      a.Password,
+		}
+	}
+
+	for host, auth := range loadDockerConfigAuths() {
+		if _, exists := byHost[host]; !exists {
+			byHost[host] = auth
+		}
+	}
+
+	return &authResolver{byHost: byHost}
+}
+
+func (r *authResolver) Resolve(imagePath string) (types.AuthConfig, bool) {
+	host := registryHost(imagePath)
+	auth, ok := r.byHost[host]
+	return auth, ok
+}
+
+func (r *authResolver) All() map[string]types.AuthConfig {
+	return r.byHost
+}
+
+// registryHost parses the registry host out of an image reference, defaulting
+// to Docker Hub when none is present - mirroring reference.ParseNamed
+// semantics.
+func registryHost(imagePath string) string {
+	name := imagePath
+	if i := strings.IndexByte(name, '@'); i != -1 {
+		name = name[:i]
+	}
+
+	slash := strings.IndexByte(name, '/')
+	if slash == -1 {
+		return defaultRegistryHost
+	}
+
+	candidate := name[:slash]
+	if !strings.ContainsAny(candidate, ".:") && candidate != "localhost" {
+		return defaultRegistryHost
+	}
+
+	return candidate
+}
+
+// dockerConfigFile mirrors the subset of $DOCKER_CONFIG/config.json this
+// module cares about.
+type dockerConfigFile struct {
+	Auths       map[string]dockerConfigAuthEntry `json:"auths"`
+	CredsStore  string                           `json:"credsStore"`
+	CredHelpers map[string]string                `json:"credHelpers"`
+}
+
+type dockerConfigAuthEntry struct {
+	Auth string `json:"auth"`
+}
+
+// credentialHelperOutput is the JSON payload a docker-credential-<name>
+// helper prints on stdout in response to a "get" request.
+type credentialHelperOutput struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+func loadDockerConfigAuths() map[string]types.AuthConfig {
+	cfg, err := readDockerConfigFile()
+	if err != nil {
+		return map[string]types.AuthConfig{}
+	}
+	return resolveConfigAuths(cfg, credentialsFromHelper)
+}
+
+// resolveConfigAuths applies cfg's inline "auths" entries, then credsStore
+// (for hosts listed under "auths"), then credHelpers, each overriding the
+// previous on conflict, so credHelpers win as in the docker CLI. helper is
+// injected so this can be unit
+// tested without shelling out to a real docker-credential-<name> binary.
+func resolveConfigAuths(cfg *dockerConfigFile, helper func(helperName, host string) (types.AuthConfig, bool)) map[string]types.AuthConfig {
+	result := make(map[string]types.AuthConfig)
+
+	for host, entry := range cfg.Auths {
+		if username, password, ok := decodeBasicAuth(entry.Auth); ok {
+			result[host] = types.AuthConfig{
+				ServerAddress: host,
+				Username:      username,
+				Password:      password,
+			}
+		}
+
+		// A host can be listed under "auths" with no inline auth string at
+		// all - that's how config.json records "this host's credentials
+		// live in credsStore", the common case for credential-helper-only
+		// setups like Docker Desktop's osxkeychain. Resolve those through
+		// credsStore below even though the loop above found nothing.
+		if cfg.CredsStore != "" {
+			if auth, ok := helper(cfg.CredsStore, host); ok {
+				result[host] = auth
+			}
+		}
+	}
+
+	for host, helperName := range cfg.CredHelpers {
+		if auth, ok := helper(helperName, host); ok {
+			result[host] = auth
+		}
+	}
+
+	return result
+}
+
+func readDockerConfigFile() (*dockerConfigFile, error) {
+	path := os.Getenv("DOCKER_CONFIG")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(path, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func decodeBasicAuth(auth string) (username, password string, ok bool) {
+	if auth == "" {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// credentialsFromHelper shells out to docker-credential-<name> with "get"
+// and host on stdin, following the protocol documented at
+// https://github.com/docker/docker-credential-helpers.
+func credentialsFromHelper(name, host string) (types.AuthConfig, bool) {
+	cmd := exec.Command("docker-credential-"+name, "get")
+	cmd.Stdin = strings.NewReader(host)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return types.AuthConfig{}, false
+	}
+
+	var resp credentialHelperOutput
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		return types.AuthConfig{}, false
+	}
+
+	return types.AuthConfig{
+		ServerAddress: host,
+		Username:      resp.Username,
+		Password:      resp.Secret,
+	}, true
+}
+
+func encodeAuthBase64(auth types.AuthConfig) (string, error) {
+	authBytes, err := json.Marshal(auth)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal auth config")
+	}
+	return base64.URLEncoding.EncodeToString(authBytes), nil
+}
@@ -0,0 +1,94 @@
+package godocker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestRegistryHost(t *testing.T) {
+	cases := map[string]string{
+		"ubuntu:16.04":                      defaultRegistryHost,
+		"library/ubuntu":                    defaultRegistryHost,
+		"myuser/myimage:latest":             defaultRegistryHost,
+		"localhost/myimage":                 "localhost",
+		"localhost:5000/myimage":            "localhost:5000",
+		"registry.example.com/myimage":      "registry.example.com",
+		"registry.example.com:5000/myimage": "registry.example.com:5000",
+		"gcr.io/project/image@sha256:abcd":  "gcr.io",
+	}
+
+	for ref, want := range cases {
+		if got := registryHost(ref); got != want {
+			t.Errorf("registryHost(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestDecodeBasicAuth(t *testing.T) {
+	// base64("user:pass")
+	username, password, ok := decodeBasicAuth("dXNlcjpwYXNz")
+	if !ok || username != "user" || password != "pass" {
+		t.Fatalf("got (%q, %q, %v), want (user, pass, true)", username, password, ok)
+	}
+
+	if _, _, ok := decodeBasicAuth(""); ok {
+		t.Fatal("expected decodeBasicAuth(\"\") to fail")
+	}
+
+	if _, _, ok := decodeBasicAuth("not-base64!!"); ok {
+		t.Fatal("expected decodeBasicAuth of invalid base64 to fail")
+	}
+}
+
+// TestResolveConfigAuthsCredsStoreOnlyHost covers the common real-world shape
+// where a host is listed under "auths" with no inline auth string at all -
+// Docker Desktop's osxkeychain setup being the canonical example - and its
+// credentials live entirely in credsStore.
+func TestResolveConfigAuthsCredsStoreOnlyHost(t *testing.T) {
+	cfg := &dockerConfigFile{
+		Auths: map[string]dockerConfigAuthEntry{
+			"registry.example.com": {},
+		},
+		CredsStore: "osxkeychain",
+	}
+
+	helper := func(helperName, host string) (types.AuthConfig, bool) {
+		if helperName != "osxkeychain" || host != "registry.example.com" {
+			return types.AuthConfig{}, false
+		}
+		return types.AuthConfig{ServerAddress: host, Username: "from-helper", Password: "secret"}, true
+	}
+
+	result := resolveConfigAuths(cfg, helper)
+
+	auth, ok := result["registry.example.com"]
+	if !ok {
+		t.Fatal("expected credsStore-only host to resolve credentials, got none")
+	}
+	if auth.Username != "from-helper" || auth.Password != "secret" {
+		t.Fatalf("unexpected auth: %+v", auth)
+	}
+}
+
+func TestResolveConfigAuthsCredHelpersOverrideInlineAuth(t *testing.T) {
+	cfg := &dockerConfigFile{
+		Auths: map[string]dockerConfigAuthEntry{
+			"registry.example.com": {Auth: "dXNlcjpwYXNz"}, // user:pass
+		},
+		CredHelpers: map[string]string{
+			"registry.example.com": "ecr-login",
+		},
+	}
+
+	helper := func(helperName, host string) (types.AuthConfig, bool) {
+		return types.AuthConfig{ServerAddress: host, Username: "ecr", Password: "token"}, true
+	}
+
+	result := resolveConfigAuths(cfg, helper)
+
+	auth := result["registry.example.com"]
+	if auth.Username != "ecr" || auth.Password != "token" {
+		t.Fatalf("expected credHelpers entry to win, got %+v", auth)
+	}
+}
@@ -0,0 +1,358 @@
+package godocker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
+	"github.com/pkg/errors"
+)
+
+// Builder backend names accepted by Configs.Builder.
+const (
+	BuilderClassic  = "classic"
+	BuilderBuildKit = "buildkit"
+	BuilderAuto     = "auto"
+)
+
+// BuildRequest carries everything needed to build an image, independent of
+// which Builder backend executes it. Target, Labels, CacheFrom, Secrets, SSH
+// and Platform are honored by buildKitBuilder; classicBuilder honors every
+// field except Secrets and SSH, which the classic daemon builder has no
+// equivalent for.
+type BuildRequest struct {
+	ContextDirectory string
+	Dockerfile       string
+	Tags             []string
+	BuildArgs        map[string]*string
+	Target           string
+	Labels           map[string]string
+	CacheFrom        []string
+	// Secrets are buildKitBuilder-only, one entry per --secret flag docker
+	// buildx would accept: "id=<name>,src=<path>" (src/source are
+	// interchangeable), or "id=<name>,env=<name>" for an env-backed secret.
+	Secrets []string
+	// SSH are buildKitBuilder-only, one entry per --ssh flag docker buildx
+	// would accept: "default" to forward $SSH_AUTH_SOCK under the default
+	// ID, or "id=<name>,src=<path>" to forward a specific socket or key.
+	SSH      []string
+	Platform string
+}
+
+// BuildResult is what a Builder reports once an image has been built.
+type BuildResult struct {
+	ImageID string
+	Tags    []string
+}
+
+// Builder builds a docker image from a BuildRequest. dockerCmd.Build is
+// implemented in terms of a Builder so the backend (classic daemon builder
+// vs BuildKit) can be swapped without touching call sites.
+type Builder interface {
+	Build(ctx context.Context, req BuildRequest) (BuildResult, error)
+}
+
+// progressBuilder is implemented by Builder backends that can stream
+// progress events while building. dockerCmd.BuildWithProgress uses it when
+// the configured backend supports it, so the progress-streaming API stays
+// in sync with whichever backend Configs.Builder selected.
+type progressBuilder interface {
+	BuildWithProgress(ctx context.Context, req BuildRequest) (<-chan ProgressEvent, <-chan error, error)
+}
+
+// classicBuilder builds images the way the docker daemon always has, via
+// cli.ImageBuild.
+type classicBuilder struct {
+	cli             *client.Client
+	registryAuthMap map[string]types.AuthConfig
+	noCache         bool
+	forceRm         bool
+	pull            bool
+}
+
+// imageBuildOptions translates a BuildRequest into the options cli.ImageBuild
+// expects, filling in classicBuilder's defaults (NoCache/ForceRemove/Pull and
+// the resolved per-host auth map) the way Build and BuildWithProgress both
+// need.
+func (b *classicBuilder) imageBuildOptions(req BuildRequest) (string, types.ImageBuildOptions) {
+	dockerfile := req.Dockerfile
+	if dockerfile == "" {
+		dockerfile = defaultDockerfile
+	}
+
+	return dockerfile, types.ImageBuildOptions{
+		Tags:        req.Tags,
+		NoCache:     b.noCache,
+		Remove:      true,
+		ForceRemove: b.forceRm,
+		PullParent:  b.pull,
+		Dockerfile:  dockerfile,
+		AuthConfigs: b.registryAuthMap,
+		BuildArgs:   req.BuildArgs,
+		Target:      req.Target,
+		Labels:      req.Labels,
+		CacheFrom:   req.CacheFrom,
+		Platform:    req.Platform,
+	}
+}
+
+func (b *classicBuilder) Build(ctx context.Context, req BuildRequest) (BuildResult, error) {
+	dockerfile, opts := b.imageBuildOptions(req)
+
+	buildCtx, err := CreateTar(req.ContextDirectory, dockerfile)
+	if err != nil {
+		return BuildResult{}, err
+	}
+	defer buildCtx.Close()
+
+	response, err := b.cli.ImageBuild(ctx, buildCtx, opts)
+	if err != nil {
+		return BuildResult{}, err
+	}
+	defer response.Body.Close()
+
+	imageID, err := decodeBuildID(response.Body)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	return BuildResult{ImageID: imageID, Tags: req.Tags}, nil
+}
+
+// BuildWithProgress behaves like Build but streams the daemon's progress
+// messages back instead of only surfacing a terminal error. The error
+// channel receives exactly one value - the final build error, or nil on
+// success - once the events channel has been closed.
+func (b *classicBuilder) BuildWithProgress(ctx context.Context, req BuildRequest) (<-chan ProgressEvent, <-chan error, error) {
+	dockerfile, opts := b.imageBuildOptions(req)
+
+	buildCtx, err := CreateTar(req.ContextDirectory, dockerfile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response, err := b.cli.ImageBuild(ctx, buildCtx, opts)
+	if err != nil {
+		buildCtx.Close()
+		return nil, nil, err
+	}
+
+	events := make(chan ProgressEvent)
+	errc := make(chan error, 1)
+	go func() {
+		defer buildCtx.Close()
+		defer response.Body.Close()
+		decodeProgress(response.Body, events, errc)
+	}()
+
+	return events, errc, nil
+}
+
+// buildKitBuilder builds images through a moby/buildkit client using the
+// dockerfile.v0 frontend, giving access to cache import/export, --target,
+// --secret, --ssh and multi-platform builds that the classic daemon builder
+// doesn't expose.
+type buildKitBuilder struct {
+	client          *bkclient.Client
+	registryAuthMap map[string]types.AuthConfig
+}
+
+func newBuildKitBuilder(dockerHost string, registryAuthMap map[string]types.AuthConfig) (*buildKitBuilder, error) {
+	bk, err := bkclient.New(context.Background(), dockerHost)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect to buildkit")
+	}
+	return &buildKitBuilder{client: bk, registryAuthMap: registryAuthMap}, nil
+}
+
+// sessionAttachables builds the buildkit session attachables a solve needs:
+// a docker auth provider seeded from the same per-host auth map Build and
+// Push resolve credentials from, plus one attachable per --secret/--ssh
+// entry on req.
+func (b *buildKitBuilder) sessionAttachables(req BuildRequest) ([]session.Attachable, error) {
+	attachables := []session.Attachable{
+		authprovider.NewDockerAuthProvider(&configfile.ConfigFile{AuthConfigs: b.registryAuthMap}),
+	}
+
+	if len(req.Secrets) > 0 {
+		sources := make([]secretsprovider.Source, 0, len(req.Secrets))
+		for _, spec := range req.Secrets {
+			sources = append(sources, parseSecretSpec(spec))
+		}
+		store, err := secretsprovider.NewFileStore(sources)
+		if err != nil {
+			return nil, errors.Wrap(err, "load --secret sources")
+		}
+		attachables = append(attachables, secretsprovider.NewSecretProvider(store))
+	}
+
+	if len(req.SSH) > 0 {
+		configs := make([]sshprovider.AgentConfig, 0, len(req.SSH))
+		for _, spec := range req.SSH {
+			configs = append(configs, parseSSHSpec(spec))
+		}
+		sshProvider, err := sshprovider.NewSSHAgentProvider(configs)
+		if err != nil {
+			return nil, errors.Wrap(err, "load --ssh agent sockets")
+		}
+		attachables = append(attachables, sshProvider)
+	}
+
+	return attachables, nil
+}
+
+// parseSecretSpec parses one --secret value, "id=name,src=/path/to/file", the
+// same format docker buildx accepts.
+func parseSecretSpec(spec string) secretsprovider.Source {
+	var src secretsprovider.Source
+	for _, field := range strings.Split(spec, ",") {
+		k, v, _ := strings.Cut(field, "=")
+		switch k {
+		case "id":
+			src.ID = v
+		case "src", "source":
+			src.FilePath = v
+		case "env":
+			src.Env = v
+		}
+	}
+	if src.ID == "" {
+		src.ID = src.FilePath
+	}
+	return src
+}
+
+// parseSSHSpec parses one --ssh value, "default" or "id=name,src=/path/to/socket",
+// the same format docker buildx accepts. A bare id with no src falls back to
+// the SSH_AUTH_SOCK agent, same as sshprovider does when Paths is empty.
+func parseSSHSpec(spec string) sshprovider.AgentConfig {
+	if !strings.Contains(spec, "=") {
+		return sshprovider.AgentConfig{ID: spec}
+	}
+
+	cfg := sshprovider.AgentConfig{}
+	for _, field := range strings.Split(spec, ",") {
+		k, v, _ := strings.Cut(field, "=")
+		switch k {
+		case "id":
+			cfg.ID = v
+		case "src", "source":
+			cfg.Paths = append(cfg.Paths, v)
+		}
+	}
+	return cfg
+}
+
+func (b *buildKitBuilder) Build(ctx context.Context, req BuildRequest) (BuildResult, error) {
+	dockerfile := req.Dockerfile
+	if dockerfile == "" {
+		dockerfile = defaultDockerfile
+	}
+
+	frontendAttrs := map[string]string{
+		"filename": dockerfile,
+		"target":   req.Target,
+	}
+	if req.Platform != "" {
+		frontendAttrs["platform"] = req.Platform
+	}
+	for k, v := range req.BuildArgs {
+		if v != nil {
+			frontendAttrs["build-arg:"+k] = *v
+		}
+	}
+	for k, v := range req.Labels {
+		frontendAttrs["label:"+k] = v
+	}
+
+	attachables, err := b.sessionAttachables(req)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	var cacheImports []bkclient.CacheOptionsEntry
+	for _, ref := range req.CacheFrom {
+		cacheImports = append(cacheImports, bkclient.CacheOptionsEntry{
+			Type:  "registry",
+			Attrs: map[string]string{"ref": ref},
+		})
+	}
+
+	solveOpt := bkclient.SolveOpt{
+		Frontend:      "dockerfile.v0",
+		FrontendAttrs: frontendAttrs,
+		LocalDirs: map[string]string{
+			"context":    req.ContextDirectory,
+			"dockerfile": req.ContextDirectory,
+		},
+		Exports: []bkclient.ExportEntry{
+			{
+				Type: "image",
+				Attrs: map[string]string{
+					"name": strings.Join(req.Tags, ","),
+					"push": "false",
+				},
+			},
+		},
+		CacheImports: cacheImports,
+		Session:      attachables,
+	}
+
+	resp, err := b.client.Solve(ctx, nil, solveOpt, nil)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	return BuildResult{ImageID: resp.ExporterResponse["containerimage.digest"], Tags: req.Tags}, nil
+}
+
+// newBuilder picks a Builder implementation based on cfg.Builder. "auto"
+// probes the daemon for BuildKit support and falls back to the classic
+// builder when it isn't available.
+func newBuilder(cfg Configs, cli *client.Client, registryAuthMap map[string]types.AuthConfig) (Builder, error) {
+	classic := &classicBuilder{
+		cli:             cli,
+		registryAuthMap: registryAuthMap,
+		noCache:         true,
+		forceRm:         true,
+		pull:            true,
+	}
+
+	switch cfg.Builder {
+	case "", BuilderClassic:
+		return classic, nil
+	case BuilderBuildKit:
+		return newBuildKitBuilder(cfg.Host, registryAuthMap)
+	case BuilderAuto:
+		if probeBuildKit(cli) {
+			if bk, err := newBuildKitBuilder(cfg.Host, registryAuthMap); err == nil {
+				return bk, nil
+			}
+		}
+		return classic, nil
+	default:
+		return nil, errors.Errorf("unknown builder backend %q", cfg.Builder)
+	}
+}
+
+// probeBuildKit reports whether the connected daemon advertises BuildKit
+// support via its info labels.
+func probeBuildKit(cli *client.Client) bool {
+	info, err := cli.Info(context.Background())
+	if err != nil {
+		return false
+	}
+	for _, l := range info.Labels {
+		if l == "org.mobyproject.buildkit=enabled" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package godocker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+func newTestClient(t *testing.T) *client.Client {
+	t.Helper()
+
+	cli, err := client.NewClient(defaultDockerHost, defaultDockerAPIVersion, nil, nil)
+	if err != nil {
+		t.Fatalf("client.NewClient: %v", err)
+	}
+	return cli
+}
+
+func TestNewBuilder(t *testing.T) {
+	cli := newTestClient(t)
+	registryAuthMap := map[string]types.AuthConfig{}
+
+	cases := []struct {
+		name        string
+		builder     string
+		wantErr     bool
+		wantClassic bool
+	}{
+		{name: "empty defaults to classic", builder: "", wantClassic: true},
+		{name: "classic", builder: BuilderClassic, wantClassic: true},
+		{name: "buildkit", builder: BuilderBuildKit, wantClassic: false},
+		// No daemon is reachable in this environment, so "auto" can never
+		// probe successfully and always falls back to classic.
+		{name: "auto falls back without a reachable daemon", builder: BuilderAuto, wantClassic: true},
+		{name: "unknown backend", builder: "bogus", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, err := newBuilder(Configs{Builder: c.builder}, cli, registryAuthMap)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("newBuilder(%q): expected an error, got none", c.builder)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newBuilder(%q): unexpected error: %v", c.builder, err)
+			}
+
+			_, isClassic := b.(*classicBuilder)
+			if isClassic != c.wantClassic {
+				t.Errorf("newBuilder(%q): got classic=%v, want classic=%v", c.builder, isClassic, c.wantClassic)
+			}
+		})
+	}
+}
+
+func TestImageBuildOptions(t *testing.T) {
+	registryAuthMap := map[string]types.AuthConfig{
+		"index.docker.io": {Username: "u", Password: "p"},
+	}
+	b := &classicBuilder{
+		registryAuthMap: registryAuthMap,
+		noCache:         true,
+		forceRm:         true,
+		pull:            true,
+	}
+
+	req := BuildRequest{
+		ContextDirectory: "/ctx",
+		Tags:             []string{"myrepo/myimage:latest"},
+		BuildArgs:        map[string]*string{"FOO": nil},
+		Target:           "builder",
+		Labels:           map[string]string{"k": "v"},
+		CacheFrom:        []string{"myrepo/myimage:cache"},
+		Platform:         "linux/amd64",
+	}
+
+	dockerfile, opts := b.imageBuildOptions(req)
+	if dockerfile != defaultDockerfile {
+		t.Errorf("dockerfile = %q, want %q (default when req.Dockerfile is empty)", dockerfile, defaultDockerfile)
+	}
+	if opts.Dockerfile != defaultDockerfile {
+		t.Errorf("opts.Dockerfile = %q, want %q", opts.Dockerfile, defaultDockerfile)
+	}
+	if !opts.NoCache || !opts.ForceRemove || !opts.PullParent || !opts.Remove {
+		t.Errorf("expected classicBuilder's NoCache/ForceRemove/PullParent/Remove defaults to be carried over, got %+v", opts)
+	}
+	if opts.Target != req.Target {
+		t.Errorf("opts.Target = %q, want %q", opts.Target, req.Target)
+	}
+	if opts.Labels["k"] != "v" {
+		t.Errorf("opts.Labels = %v, want k=v", opts.Labels)
+	}
+	if len(opts.CacheFrom) != 1 || opts.CacheFrom[0] != "myrepo/myimage:cache" {
+		t.Errorf("opts.CacheFrom = %v", opts.CacheFrom)
+	}
+	if opts.Platform != req.Platform {
+		t.Errorf("opts.Platform = %q, want %q", opts.Platform, req.Platform)
+	}
+	if opts.AuthConfigs["index.docker.io"].Username != "u" {
+		t.Errorf("opts.AuthConfigs not carried over from registryAuthMap: %v", opts.AuthConfigs)
+	}
+
+	req.Dockerfile = "Dockerfile.ci"
+	dockerfile, opts = b.imageBuildOptions(req)
+	if dockerfile != "Dockerfile.ci" || opts.Dockerfile != "Dockerfile.ci" {
+		t.Errorf("explicit req.Dockerfile should be preserved, got dockerfile=%q opts.Dockerfile=%q", dockerfile, opts.Dockerfile)
+	}
+}
+
+func TestParseSecretSpec(t *testing.T) {
+	src := parseSecretSpec("id=mysecret,src=/path/to/file")
+	if src.ID != "mysecret" || src.FilePath != "/path/to/file" {
+		t.Errorf("got %+v", src)
+	}
+
+	// source is an accepted alias for src.
+	src = parseSecretSpec("id=mysecret,source=/path/to/file")
+	if src.FilePath != "/path/to/file" {
+		t.Errorf("got %+v, want source= to populate FilePath", src)
+	}
+
+	// With no id given, the file path itself is used as the secret id.
+	src = parseSecretSpec("src=/path/to/file")
+	if src.ID != "/path/to/file" {
+		t.Errorf("got %+v, want ID to fall back to FilePath", src)
+	}
+}
+
+func TestParseSSHSpec(t *testing.T) {
+	cfg := parseSSHSpec("default")
+	if cfg.ID != "default" || len(cfg.Paths) != 0 {
+		t.Errorf("got %+v, want a bare ID with no Paths", cfg)
+	}
+
+	cfg = parseSSHSpec("id=mykey,src=/path/to/socket")
+	if cfg.ID != "mykey" || len(cfg.Paths) != 1 || cfg.Paths[0] != "/path/to/socket" {
+		t.Errorf("got %+v", cfg)
+	}
+}
@@ -0,0 +1,414 @@
+package godocker
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+// ContainerID identifies a container, as returned by Container.Create.
+type ContainerID string
+
+// RestartPolicy mirrors the handful of restart policies the docker API
+// supports, without exposing container.RestartPolicy directly.
+type RestartPolicy struct {
+	Name              string
+	MaximumRetryCount int
+}
+
+// ResourceLimits caps the CPU/memory a container may use.
+type ResourceLimits struct {
+	CPUShares int64
+	CPUs      float64
+	Memory    int64
+}
+
+// PortBinding maps a container port to a host port, e.g. "8080/tcp" -> "80".
+type PortBinding struct {
+	ContainerPort string
+	HostIP        string
+	HostPort      string
+}
+
+// HealthCheck mirrors the subset of container.HealthConfig callers typically
+// set.
+type HealthCheck struct {
+	Test     []string
+	Interval int64 // nanoseconds
+	Timeout  int64 // nanoseconds
+	Retries  int
+}
+
+// CreateOptions describes a container to create. It's a typed, stable
+// subset of container.Config/container.HostConfig so the surface godocker
+// exposes doesn't have to track every docker API version.
+type CreateOptions struct {
+	Name          string
+	Image         string
+	Cmd           []string
+	Entrypoint    []string
+	Env           []string
+	WorkingDir    string
+	Labels        map[string]string
+	Mounts        []Mount
+	Ports         []PortBinding
+	RestartPolicy RestartPolicy
+	Resources     ResourceLimits
+	NetworkMode   string
+	Health        *HealthCheck
+}
+
+// Mount bind-mounts a host path into the container. Every Mount is created as
+// a bind mount; named volumes are not supported.
+type Mount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// RunOptions is CreateOptions plus whether to stream the container's logs,
+// for the Run convenience method.
+type RunOptions struct {
+	CreateOptions
+	// AttachLogs causes Run to open a follow-mode stdout/stderr log stream
+	// once the container starts. Run reads that stream to its end and
+	// discards it; the log output is not returned to the caller.
+	AttachLogs bool
+}
+
+// ExecOptions describes a command to execute inside a running container.
+type ExecOptions struct {
+	Cmd          []string
+	Env          []string
+	WorkingDir   string
+	Tty          bool
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+}
+
+// ExecResult is the stream returned by Container.Exec for attached execs.
+type ExecResult struct {
+	Conn   io.ReadWriteCloser
+	Resize func(ctx context.Context, height, width uint) error
+}
+
+// LogOptions controls Container.Logs.
+type LogOptions struct {
+	Follow     bool
+	Since      string
+	Tail       string
+	ShowStdout bool
+	ShowStderr bool
+	Timestamps bool
+}
+
+// ContainerInfo is the subset of container inspect output callers need.
+type ContainerInfo struct {
+	ID      string
+	Name    string
+	Image   string
+	State   string
+	Status  string
+	Running bool
+	Pid     int
+	Created string
+}
+
+// Container is the container lifecycle counterpart to Docker's image
+// operations, implemented against the same client.Client a dockerCmd already
+// holds.
+type Container interface {
+	Create(ctx context.Context, opts CreateOptions) (ContainerID, error)
+	Start(ctx context.Context, id ContainerID) error
+	Stop(ctx context.Context, id ContainerID, timeout *int) error
+	Kill(ctx context.Context, id ContainerID, signal string) error
+	Remove(ctx context.Context, id ContainerID, force bool) error
+	Inspect(ctx context.Context, id ContainerID) (ContainerInfo, error)
+	List(ctx context.Context, all bool, filter map[string]string) ([]ContainerInfo, error)
+	Exec(ctx context.Context, id ContainerID, opts ExecOptions) (ExecResult, error)
+	Logs(ctx context.Context, id ContainerID, opts LogOptions) (io.ReadCloser, error)
+	Wait(ctx context.Context, id ContainerID) (<-chan int, <-chan error)
+	CopyTo(ctx context.Context, id ContainerID, dstPath string, content io.Reader) error
+	CopyFrom(ctx context.Context, id ContainerID, srcPath string) (io.ReadCloser, error)
+	// Run creates, starts and, if opts.AttachLogs is set, follows (and
+	// discards) the logs of a container, returning its ID and a channel
+	// that receives its exit code once it stops.
+	Run(ctx context.Context, opts RunOptions) (ContainerID, <-chan int, error)
+}
+
+func (docker *dockerCmd) Create(ctx context.Context, opts CreateOptions) (ContainerID, error) {
+	resp, err := docker.cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:        opts.Image,
+			Cmd:          opts.Cmd,
+			Entrypoint:   opts.Entrypoint,
+			Env:          opts.Env,
+			WorkingDir:   opts.WorkingDir,
+			Labels:       opts.Labels,
+			Healthcheck:  toHealthConfig(opts.Health),
+			ExposedPorts: toExposedPorts(opts.Ports),
+		},
+		&container.HostConfig{
+			Mounts:        toMounts(opts.Mounts),
+			PortBindings:  toPortMap(opts.Ports),
+			RestartPolicy: toRestartPolicy(opts.RestartPolicy),
+			NetworkMode:   container.NetworkMode(opts.NetworkMode),
+			Resources:     toResources(opts.Resources),
+		},
+		&network.NetworkingConfig{},
+		opts.Name,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return ContainerID(resp.ID), nil
+}
+
+func (docker *dockerCmd) Start(ctx context.Context, id ContainerID) error {
+	return docker.cli.ContainerStart(ctx, string(id), types.ContainerStartOptions{})
+}
+
+func (docker *dockerCmd) Stop(ctx context.Context, id ContainerID, timeout *int) error {
+	return docker.cli.ContainerStop(ctx, string(id), timeout)
+}
+
+func (docker *dockerCmd) Kill(ctx context.Context, id ContainerID, signal string) error {
+	return docker.cli.ContainerKill(ctx, string(id), signal)
+}
+
+func (docker *dockerCmd) Remove(ctx context.Context, id ContainerID, force bool) error {
+	return docker.cli.ContainerRemove(ctx, string(id), types.ContainerRemoveOptions{Force: force})
+}
+
+func (docker *dockerCmd) Inspect(ctx context.Context, id ContainerID) (ContainerInfo, error) {
+	info, err := docker.cli.ContainerInspect(ctx, string(id))
+	if err != nil {
+		return ContainerInfo{}, err
+	}
+
+	ci := ContainerInfo{
+		ID:      info.ID,
+		Name:    info.Name,
+		Image:   info.Image,
+		Created: info.Created,
+	}
+	if info.State != nil {
+		ci.State = info.State.Status
+		ci.Status = info.State.Status
+		ci.Running = info.State.Running
+		ci.Pid = info.State.Pid
+	}
+	return ci, nil
+}
+
+func (docker *dockerCmd) List(ctx context.Context, all bool, filter map[string]string) ([]ContainerInfo, error) {
+	args := filtersFromMap(filter)
+	containers, err := docker.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     all,
+		Filters: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ContainerInfo, 0, len(containers))
+	for _, c := range containers {
+		name := ""
+		if len(c.Names) > 0 {
+			name = c.Names[0]
+		}
+		infos = append(infos, ContainerInfo{
+			ID:      c.ID,
+			Name:    name,
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+			Running: c.State == "running",
+			Created: time.Unix(c.Created, 0).Format(time.RFC3339),
+		})
+	}
+	return infos, nil
+}
+
+func (docker *dockerCmd) Exec(ctx context.Context, id ContainerID, opts ExecOptions) (ExecResult, error) {
+	created, err := docker.cli.ContainerExecCreate(ctx, string(id), types.ExecConfig{
+		Cmd:          opts.Cmd,
+		Env:          opts.Env,
+		WorkingDir:   opts.WorkingDir,
+		Tty:          opts.Tty,
+		AttachStdin:  opts.AttachStdin,
+		AttachStdout: opts.AttachStdout,
+		AttachStderr: opts.AttachStderr,
+	})
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	attach, err := docker.cli.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{Tty: opts.Tty})
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	return ExecResult{
+		Conn: attach.Conn,
+		Resize: func(ctx context.Context, height, width uint) error {
+			return docker.cli.ContainerExecResize(ctx, created.ID, types.ResizeOptions{Height: height, Width: width})
+		},
+	}, nil
+}
+
+func (docker *dockerCmd) Logs(ctx context.Context, id ContainerID, opts LogOptions) (io.ReadCloser, error) {
+	return docker.cli.ContainerLogs(ctx, string(id), types.ContainerLogsOptions{
+		ShowStdout: opts.ShowStdout,
+		ShowStderr: opts.ShowStderr,
+		Since:      opts.Since,
+		Timestamps: opts.Timestamps,
+		Follow:     opts.Follow,
+		Tail:       opts.Tail,
+	})
+}
+
+func (docker *dockerCmd) Wait(ctx context.Context, id ContainerID) (<-chan int, <-chan error) {
+	statusCh, errCh := docker.cli.ContainerWait(ctx, string(id), container.WaitConditionNotRunning)
+
+	// Only the channel that actually receives a value is closed. Closing
+	// both unconditionally would make a never-written channel appear
+	// "ready" (as a closed, empty channel) at the same time as the one
+	// holding the real result, leaving callers that select on both racing
+	// Go's pseudo-random select semantics instead of reading the answer
+	// that actually arrived.
+	exitCh := make(chan int, 1)
+	outErrCh := make(chan error, 1)
+	go func() {
+		select {
+		case status := <-statusCh:
+			exitCh <- int(status.StatusCode)
+			close(exitCh)
+		case err := <-errCh:
+			outErrCh <- err
+			close(outErrCh)
+		}
+	}()
+
+	return exitCh, outErrCh
+}
+
+func (docker *dockerCmd) CopyTo(ctx context.Context, id ContainerID, dstPath string, content io.Reader) error {
+	return docker.cli.CopyToContainer(ctx, string(id), dstPath, content, types.CopyToContainerOptions{})
+}
+
+func (docker *dockerCmd) CopyFrom(ctx context.Context, id ContainerID, srcPath string) (io.ReadCloser, error) {
+	rc, _, err := docker.cli.CopyFromContainer(ctx, string(id), srcPath)
+	return rc, err
+}
+
+func (docker *dockerCmd) Run(ctx context.Context, opts RunOptions) (ContainerID, <-chan int, error) {
+	id, err := docker.Create(ctx, opts.CreateOptions)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := docker.Start(ctx, id); err != nil {
+		return id, nil, err
+	}
+
+	if opts.AttachLogs {
+		if logs, err := docker.Logs(ctx, id, LogOptions{Follow: true, ShowStdout: true, ShowStderr: true}); err == nil {
+			go func() {
+				defer logs.Close()
+				io.Copy(ioutil.Discard, logs)
+			}()
+		}
+	}
+
+	exitCh, errCh := docker.Wait(ctx, id)
+	resultCh := make(chan int, 1)
+	go func() {
+		select {
+		case code := <-exitCh:
+			resultCh <- code
+		case <-errCh:
+			resultCh <- -1
+		}
+		close(resultCh)
+	}()
+
+	return id, resultCh, nil
+}
+
+func toHealthConfig(h *HealthCheck) *container.HealthConfig {
+	if h == nil {
+		return nil
+	}
+	return &container.HealthConfig{
+		Test:     h.Test,
+		Interval: time.Duration(h.Interval),
+		Timeout:  time.Duration(h.Timeout),
+		Retries:  h.Retries,
+	}
+}
+
+func toRestartPolicy(p RestartPolicy) container.RestartPolicy {
+	return container.RestartPolicy{
+		Name:              p.Name,
+		MaximumRetryCount: p.MaximumRetryCount,
+	}
+}
+
+func toResources(r ResourceLimits) container.Resources {
+	return container.Resources{
+		CPUShares: r.CPUShares,
+		Memory:    r.Memory,
+		NanoCPUs:  int64(r.CPUs * 1e9),
+	}
+}
+
+func toMounts(mounts []Mount) []mount.Mount {
+	result := make([]mount.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		result = append(result, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+	return result
+}
+
+func toExposedPorts(ports []PortBinding) nat.PortSet {
+	set := make(nat.PortSet, len(ports))
+	for _, p := range ports {
+		set[nat.Port(p.ContainerPort)] = struct{}{}
+	}
+	return set
+}
+
+func toPortMap(ports []PortBinding) nat.PortMap {
+	m := make(nat.PortMap, len(ports))
+	for _, p := range ports {
+		m[nat.Port(p.ContainerPort)] = append(m[nat.Port(p.ContainerPort)], nat.PortBinding{
+			HostIP:   p.HostIP,
+			HostPort: p.HostPort,
+		})
+	}
+	return m
+}
+
+func filtersFromMap(filter map[string]string) filters.Args {
+	args := filters.NewArgs()
+	for k, v := range filter {
+		args.Add(k, v)
+	}
+	return args
+}
@@ -0,0 +1,108 @@
+package godocker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestToPortMapAndExposedPorts(t *testing.T) {
+	ports := []PortBinding{
+		{ContainerPort: "80/tcp", HostIP: "0.0.0.0", HostPort: "8080"},
+	}
+
+	set := toExposedPorts(ports)
+	if _, ok := set["80/tcp"]; !ok {
+		t.Fatalf("expected 80/tcp to be exposed, got %+v", set)
+	}
+
+	m := toPortMap(ports)
+	bindings, ok := m["80/tcp"]
+	if !ok || len(bindings) != 1 {
+		t.Fatalf("expected one binding for 80/tcp, got %+v", m)
+	}
+	if bindings[0].HostPort != "8080" || bindings[0].HostIP != "0.0.0.0" {
+		t.Fatalf("unexpected binding: %+v", bindings[0])
+	}
+}
+
+func TestToMounts(t *testing.T) {
+	mounts := toMounts([]Mount{
+		{Source: "/host", Target: "/container", ReadOnly: true},
+	})
+	if len(mounts) != 1 {
+		t.Fatalf("expected 1 mount, got %d", len(mounts))
+	}
+	if mounts[0].Source != "/host" || mounts[0].Target != "/container" || !mounts[0].ReadOnly {
+		t.Fatalf("unexpected mount: %+v", mounts[0])
+	}
+}
+
+func TestToResources(t *testing.T) {
+	r := toResources(ResourceLimits{CPUShares: 512, Memory: 1024, CPUs: 1.5})
+	if r.CPUShares != 512 || r.Memory != 1024 || r.NanoCPUs != 1500000000 {
+		t.Fatalf("unexpected resources: %+v", r)
+	}
+}
+
+// waitSelect mirrors the select Wait's goroutine performs, so the fix
+// for the exitCh/errCh race can be exercised without a live daemon.
+func waitSelect(statusCh <-chan int, errCh <-chan error) (exitCh <-chan int, outErrCh <-chan error) {
+	ec := make(chan int, 1)
+	oec := make(chan error, 1)
+	go func() {
+		select {
+		case status := <-statusCh:
+			ec <- status
+			close(ec)
+		case err := <-errCh:
+			oec <- err
+			close(oec)
+		}
+	}()
+	return ec, oec
+}
+
+func TestWaitDoesNotRaceOnCleanExit(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		statusCh := make(chan int, 1)
+		errCh := make(chan error, 1)
+		statusCh <- 0
+
+		exitCh, outErrCh := waitSelect(statusCh, errCh)
+
+		select {
+		case code := <-exitCh:
+			if code != 0 {
+				t.Fatalf("expected exit code 0, got %d", code)
+			}
+		case err := <-outErrCh:
+			t.Fatalf("expected exit code, got spurious error %v (the never-written channel was closed too)", err)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for exit code")
+		}
+	}
+}
+
+func TestWaitDoesNotRaceOnError(t *testing.T) {
+	wantErr := errors.New("boom")
+
+	for i := 0; i < 100; i++ {
+		statusCh := make(chan int, 1)
+		errCh := make(chan error, 1)
+		errCh <- wantErr
+
+		exitCh, outErrCh := waitSelect(statusCh, errCh)
+
+		select {
+		case code := <-exitCh:
+			t.Fatalf("expected error, got spurious exit code %d (the never-written channel was closed too)", code)
+		case err := <-outErrCh:
+			if err != wantErr {
+				t.Fatalf("expected %v, got %v", wantErr, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for error")
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package godocker
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/pkg/errors"
+)
+
+// PushResult is what Push reports once the daemon has finished pushing an
+// image, parsed out of the final progress message's Aux payload.
+type PushResult struct {
+	Ref    string
+	Digest string
+	Size   int64
+}
+
+// buildAux is the Aux payload the daemon emits on a successful build, naming
+// the resulting image ID.
+type buildAux struct {
+	ID string `json:"ID"`
+}
+
+// pushAux is the Aux payload the daemon emits once a push completes,
+// matching types.PushResult's JSON shape.
+type pushAux struct {
+	Tag    string `json:"Tag"`
+	Digest string `json:"Digest"`
+	Size   int64  `json:"Size"`
+}
+
+// decodeBuildID walks the daemon's JSON progress stream the same way
+// detectErrorMessage does, additionally capturing the built image ID out of
+// the last message's Aux field.
+func decodeBuildID(in io.Reader) (string, error) {
+	dec := json.NewDecoder(in)
+	imageID := ""
+
+	for {
+		var jm jsonmessage.JSONMessage
+		if err := dec.Decode(&jm); err != nil {
+			if err == io.EOF {
+				return imageID, nil
+			}
+			return imageID, err
+		}
+
+		if jm.Aux != nil {
+			var aux buildAux
+			if err := json.Unmarshal(*jm.Aux, &aux); err == nil && aux.ID != "" {
+				imageID = aux.ID
+			}
+		}
+
+		if jm.Error != nil {
+			return imageID, jm.Error
+		}
+		if len(jm.ErrorMessage) > 0 {
+			return imageID, errors.New(jm.ErrorMessage)
+		}
+	}
+}
+
+// decodePushResult walks the daemon's JSON progress stream for a push,
+// capturing the pushed manifest digest out of the last message's Aux field.
+func decodePushResult(in io.Reader, ref string) (PushResult, error) {
+	dec := json.NewDecoder(in)
+	result := PushResult{Ref: ref}
+
+	for {
+		var jm jsonmessage.JSONMessage
+		if err := dec.Decode(&jm); err != nil {
+			if err == io.EOF {
+				return result, nil
+			}
+			return result, err
+		}
+
+		if jm.Aux != nil {
+			var aux pushAux
+			if err := json.Unmarshal(*jm.Aux, &aux); err == nil && aux.Digest != "" {
+				result.Digest = aux.Digest
+				result.Size = aux.Size
+			}
+		}
+
+		if jm.Error != nil {
+			return result, jm.Error
+		}
+		if len(jm.ErrorMessage) > 0 {
+			return result, errors.New(jm.ErrorMessage)
+		}
+	}
+}
@@ -44,12 +44,41 @@ type ImageSummary struct {
 
 // Docker is an interface that contains some operations which can be used to build a image from source code
 type Docker interface {
-	Build(ctx context.Context, contextDirectory, imagePath string, args map[string]*string) error
+	Build(ctx context.Context, contextDirectory, imagePath string, args map[string]*string) (BuildResult, error)
+	// BuildEx behaves like Build but takes a full BuildRequest, so callers
+	// can opt into the fields Build's simpler signature has no room for:
+	// Target, Labels, CacheFrom, Secrets, SSH and Platform. ContextDirectory
+	// is still required; Dockerfile defaults to "Dockerfile" when empty,
+	// same as Build.
+	BuildEx(ctx context.Context, req BuildRequest) (BuildResult, error)
 	Pull(ctx context.Context, imagePath string) error
-	Push(ctx context.Context, imagePath string) error
+	Push(ctx context.Context, imagePath string) (PushResult, error)
+	// BuildWithProgress, PullWithProgress and PushWithProgress behave like
+	// their plain counterparts but stream the daemon's JSON progress
+	// messages back on a channel instead of only surfacing a terminal
+	// error, so callers can render live progress or forward it to their
+	// own logs. See DisplayProgress for a ready-made io.Writer sink.
+	BuildWithProgress(ctx context.Context, contextDirectory, imagePath string, args map[string]*string) (<-chan ProgressEvent, <-chan error, error)
+	// BuildExWithProgress is to BuildWithProgress what BuildEx is to Build.
+	BuildExWithProgress(ctx context.Context, req BuildRequest) (<-chan ProgressEvent, <-chan error, error)
+	PullWithProgress(ctx context.Context, imagePath string) (<-chan ProgressEvent, <-chan error, error)
+	PushWithProgress(ctx context.Context, imagePath string) (<-chan ProgressEvent, <-chan error, error)
 	List(ctx context.Context, filters map[string]string) ([]*ImageSummary, error)
 	Tag(ctx context.Context, imagePath, newImagePath string) error
 	Rmi(ctx context.Context, imagePath string) error
+	// Save writes a tar archive of imagePaths, in the same format accepted
+	// by Load, to w.
+	Save(ctx context.Context, imagePaths []string, w io.Writer) error
+	// Load reads a tar archive produced by Save (or `docker save`) from r
+	// and imports it into the daemon.
+	Load(ctx context.Context, r io.Reader, quiet bool) error
+	// Flatten squashes every layer of srcImage into a single layer,
+	// producing dstImage.
+	Flatten(ctx context.Context, srcImage, dstImage string, opts FlattenOptions) error
+
+	// Container exposes the container lifecycle operations (run/exec/
+	// logs/wait/...) on the same daemon connection.
+	Container
 }
 
 type dockerCmd struct {
@@ -58,9 +87,11 @@ type dockerCmd struct {
 	registry           string
 	registryAuthString string
 	registryAuthMap    map[string]types.AuthConfig
+	authResolver       AuthResolver
 	noCache            bool
 	forceRm            bool
 	pull               bool
+	builder            Builder
 }
 
 // Configs is used to create the docker client
@@ -69,6 +100,15 @@ type Configs struct {
 	Registry string
 	User     string
 	Passwd   string
+	// Auths holds credentials for additional registries beyond Registry/
+	// User/Passwd. Combined with $DOCKER_CONFIG/config.json (including
+	// credHelpers/credsStore) to resolve the right credential for any
+	// image reference.
+	Auths []RegistryAuth
+	// Builder selects the image build backend: "classic" (default),
+	// "buildkit", or "auto" to probe the daemon and prefer BuildKit when
+	// it's available.
+	Builder string
 }
 
 // NewClient will return a docker image builder client
@@ -84,58 +124,62 @@ func NewClient(cfg Configs) (Docker, error) {
 	authBytes, _ := json.Marshal(auth)
 	authBase64 := base64.URLEncoding.EncodeToString(authBytes)
 
+	if cfg.Registry != "" {
+		cfg.Auths = append(cfg.Auths, RegistryAuth{
+			Host:     cfg.Registry,
+			Username: cfg.User,
+			Password: cfg.Passwd,
+		})
+	}
+	authResolver := newAuthResolver(cfg)
+	registryAuthMap := authResolver.All()
+
+	builder, err := newBuilder(cfg, cli, registryAuthMap)
+	if err != nil {
+		return nil, err
+	}
+
 	docker := &dockerCmd{
 		cli:                cli,
 		dockerHost:         cfg.Host,
 		registry:           cfg.Registry,
 		registryAuthString: authBase64,
-		registryAuthMap: map[string]types.AuthConfig{
-			cfg.Registry: auth,
-		},
-		noCache: true,
-		forceRm: true,
-		pull:    true,
+		registryAuthMap:    registryAuthMap,
+		authResolver:       authResolver,
+		noCache:            true,
+		forceRm:            true,
+		pull:               true,
+		builder:            builder,
 	}
 
 	return docker, nil
 }
 
-func (docker *dockerCmd) Build(ctx context.Context, contextDirectory, imagePath string, args map[string]*string) error {
-	dockerfile := defaultDockerfile
-
-	buildCtx, err := CreateTar(contextDirectory, dockerfile)
-	if err != nil {
-		return err
-	}
-	defer buildCtx.Close()
-
-	response, err := docker.cli.ImageBuild(ctx, buildCtx, types.ImageBuildOptions{
-		Tags:        []string{imagePath},
-		NoCache:     docker.noCache,
-		Remove:      true,
-		ForceRemove: docker.forceRm,
-		PullParent:  docker.pull,
-		Dockerfile:  defaultDockerfile,
-		AuthConfigs: docker.registryAuthMap,
-		BuildArgs:   args,
+func (docker *dockerCmd) Build(ctx context.Context, contextDirectory, imagePath string, args map[string]*string) (BuildResult, error) {
+	return docker.BuildEx(ctx, BuildRequest{
+		ContextDirectory: contextDirectory,
+		Dockerfile:       defaultDockerfile,
+		Tags:             []string{imagePath},
+		BuildArgs:        args,
 	})
-	defer response.Body.Close()
-	if err != nil {
-		return err
-	}
+}
 
-	//body, err := ioutil.ReadAll(response.Body)
-	if err = detectErrorMessage(response.Body); err != nil {
-		return err
+func (docker *dockerCmd) BuildEx(ctx context.Context, req BuildRequest) (BuildResult, error) {
+	if req.Dockerfile == "" {
+		req.Dockerfile = defaultDockerfile
 	}
-
-	return nil
+	return docker.builder.Build(ctx, req)
 }
 
 func (docker *dockerCmd) Pull(ctx context.Context, imagePath string) error {
-	resp, err := docker.cli.ImagePull(ctx, imagePath, types.ImagePullOptions{
-	//RegistryAuth: docker.registryAuthString,
-	})
+	pullOpts := types.ImagePullOptions{}
+	if auth, ok := docker.authResolver.Resolve(imagePath); ok {
+		if authBase64, err := encodeAuthBase64(auth); err == nil {
+			pullOpts.RegistryAuth = authBase64
+		}
+	}
+
+	resp, err := docker.cli.ImagePull(ctx, imagePath, pullOpts)
 	if resp != nil {
 		defer resp.Close()
 	}
@@ -149,22 +193,25 @@ func (docker *dockerCmd) Pull(ctx context.Context, imagePath string) error {
 	return nil
 }
 
-func (docker *dockerCmd) Push(ctx context.Context, imagePath string) error {
-	resp, err := docker.cli.ImagePush(ctx, imagePath, types.ImagePushOptions{
+func (docker *dockerCmd) Push(ctx context.Context, imagePath string) (PushResult, error) {
+	pushOpts := types.ImagePushOptions{
 		RegistryAuth: docker.registryAuthString,
-	})
+	}
+	if auth, ok := docker.authResolver.Resolve(imagePath); ok {
+		if authBase64, err := encodeAuthBase64(auth); err == nil {
+			pushOpts.RegistryAuth = authBase64
+		}
+	}
+
+	resp, err := docker.cli.ImagePush(ctx, imagePath, pushOpts)
 	if resp != nil {
 		defer resp.Close()
 	}
 	if err != nil {
-		return err
-	}
-	//body, err := ioutil.ReadAll(resp)
-	if err = detectErrorMessage(resp); err != nil {
-		return err
+		return PushResult{}, err
 	}
 
-	return nil
+	return decodePushResult(resp, imagePath)
 }
 
 func (docker *dockerCmd) List(ctx context.Context, filter map[string]string) ([]*ImageSummary, error) {
@@ -24,11 +24,11 @@ func TestDockerbuild(t *testing.T) {
 		Registry: localRegistry,
 	})
 
-	if err := docker.Build(context.TODO(), repoLocalPath, localRegistry+"/public/build-test:master", map[string]*string{}); err != nil {
+	if _, err := docker.Build(context.TODO(), repoLocalPath, localRegistry+"/public/build-test:master", map[string]*string{}); err != nil {
 		t.Fatal("build docker image failed:", err)
 	}
 
-	if err := docker.Push(context.TODO(), localRegistry+"/public/build-test:master"); err != nil {
+	if _, err := docker.Push(context.TODO(), localRegistry+"/public/build-test:master"); err != nil {
 		t.Fatal("push docker image failed:", err)
 	}
 
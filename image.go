@@ -0,0 +1,397 @@
+package godocker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+)
+
+// FlattenOptions controls how Flatten squashes an image's layers.
+type FlattenOptions struct {
+	// Labels are merged into (overriding on conflict) the labels copied
+	// from the source image's config.
+	Labels map[string]string
+}
+
+// ociImageConfig is the subset of an image's config.json this module reads
+// and rewrites when flattening.
+type ociImageConfig struct {
+	Config struct {
+		Env          []string            `json:"Env"`
+		Cmd          []string            `json:"Cmd"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		WorkingDir   string              `json:"WorkingDir"`
+		User         string              `json:"User"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+		Labels       map[string]string   `json:"Labels"`
+	} `json:"config"`
+	Architecture string            `json:"architecture"`
+	OS           string            `json:"os"`
+	RootFS       rootFS            `json:"rootfs"`
+	History      []json.RawMessage `json:"history,omitempty"`
+}
+
+type rootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+func (docker *dockerCmd) Save(ctx context.Context, imagePaths []string, w io.Writer) error {
+	rc, err := docker.cli.ImageSave(ctx, imagePaths)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+func (docker *dockerCmd) Load(ctx context.Context, r io.Reader, quiet bool) error {
+	resp, err := docker.cli.ImageLoad(ctx, r, quiet)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return detectErrorMessage(resp.Body)
+}
+
+// Flatten collapses every layer of srcImage into a single squashed layer,
+// producing dstImage with a config that carries over Env, Cmd, Entrypoint,
+// WorkingDir, User, ExposedPorts and Labels from the source but exactly one
+// rootfs.diff_ids entry. It works entirely off of `docker save`/`docker load`
+// so it needs no registry access beyond what's already local to the daemon.
+func (docker *dockerCmd) Flatten(ctx context.Context, srcImage, dstImage string, opts FlattenOptions) error {
+	tmpDir, err := ioutil.TempDir("", "godocker-flatten")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	savedPath := path.Join(tmpDir, "saved.tar")
+	if err := saveImageToFile(ctx, docker.cli, srcImage, savedPath); err != nil {
+		return errors.Wrap(err, "save source image")
+	}
+
+	manifest, configBytes, err := readImageManifest(savedPath)
+	if err != nil {
+		return errors.Wrap(err, "read image manifest")
+	}
+
+	var cfg ociImageConfig
+	if err := json.Unmarshal(configBytes, &cfg); err != nil {
+		return errors.Wrap(err, "parse image config")
+	}
+
+	flatLayerPath := path.Join(tmpDir, "layer.tar")
+	diffID, err := flattenLayers(savedPath, manifest.Layers, flatLayerPath)
+	if err != nil {
+		return errors.Wrap(err, "flatten layers")
+	}
+
+	for k, v := range opts.Labels {
+		if cfg.Config.Labels == nil {
+			cfg.Config.Labels = make(map[string]string)
+		}
+		cfg.Config.Labels[k] = v
+	}
+	cfg.RootFS = rootFS{Type: "layers", DiffIDs: []string{diffID}}
+	cfg.History = nil
+
+	loadTarPath := path.Join(tmpDir, "load.tar")
+	if err := writeFlattenedImageTar(loadTarPath, dstImage, cfg, flatLayerPath); err != nil {
+		return errors.Wrap(err, "write flattened image")
+	}
+
+	f, err := os.Open(loadTarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return docker.Load(ctx, f, true)
+}
+
+type ociManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+func saveImageToFile(ctx context.Context, cli *client.Client, image, destPath string) error {
+	rc, err := cli.ImageSave(ctx, []string{image})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	f, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, rc)
+	return err
+}
+
+func readImageManifest(tarPath string) (ociManifestEntry, []byte, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return ociManifestEntry{}, nil, err
+	}
+	defer f.Close()
+
+	var manifests []ociManifestEntry
+	var configName string
+	configs := make(map[string][]byte)
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ociManifestEntry{}, nil, err
+		}
+
+		switch hdr.Name {
+		case "manifest.json":
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return ociManifestEntry{}, nil, err
+			}
+			if err := json.Unmarshal(data, &manifests); err != nil {
+				return ociManifestEntry{}, nil, err
+			}
+		default:
+			if path.Ext(hdr.Name) == ".json" {
+				data, err := ioutil.ReadAll(tr)
+				if err != nil {
+					return ociManifestEntry{}, nil, err
+				}
+				configs[hdr.Name] = data
+			}
+		}
+	}
+
+	if len(manifests) == 0 {
+		return ociManifestEntry{}, nil, errors.New("manifest.json missing from saved image tar")
+	}
+	configName = manifests[0].Config
+
+	configBytes, ok := configs[configName]
+	if !ok {
+		return ociManifestEntry{}, nil, errors.Errorf("config %s missing from saved image tar", configName)
+	}
+
+	return manifests[0], configBytes, nil
+}
+
+// flattenLayers concatenates every layer tarball named in layers (read out of
+// the `docker save` tar at savedPath) into a single tarball at destPath,
+// honoring whiteout files (later layers' deletions win), and returns the
+// sha256 diff ID of the resulting layer.
+func flattenLayers(savedPath string, layers []string, destPath string) (string, error) {
+	out, err := os.Create(destPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	tw := tar.NewWriter(out)
+	written := make(map[string]bool)
+	deleted := make(map[string]bool)
+
+	// Walk layers from newest to oldest so a whiteout hides an older
+	// layer's copy of the same path, then emit survivors in that order.
+	for i := len(layers) - 1; i >= 0; i-- {
+		if err := copyLayerEntries(savedPath, layers[i], tw, written, deleted); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+
+	return diffIDOf(destPath)
+}
+
+const whiteoutPrefix = ".wh."
+
+func copyLayerEntries(savedPath, layerName string, tw *tar.Writer, written, deleted map[string]bool) error {
+	f, err := os.Open(savedPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Name != layerName {
+			continue
+		}
+
+		layerTr := tar.NewReader(tr)
+		// Opaque markers hide older layers' contents of their directory,
+		// so they take effect only after this layer has been copied.
+		opaque := make(map[string]bool)
+		for {
+			lhdr, err := layerTr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			dir, base := path.Split(lhdr.Name)
+			if base == ".wh..wh..opq" {
+				opaque[path.Clean(dir)] = true
+				continue
+			}
+			if len(base) > len(whiteoutPrefix) && base[:len(whiteoutPrefix)] == whiteoutPrefix {
+				deleted[path.Join(dir, base[len(whiteoutPrefix):])] = true
+				continue
+			}
+			// A whiteout of a directory also hides everything beneath it.
+			hidden := false
+			for p := path.Clean(lhdr.Name); !hidden; p = path.Dir(p) {
+				hidden = deleted[p]
+				if p == "." || p == "/" {
+					break
+				}
+			}
+			if written[lhdr.Name] || hidden {
+				continue
+			}
+
+			written[lhdr.Name] = true
+			if err := tw.WriteHeader(lhdr); err != nil {
+				return err
+			}
+			if lhdr.Typeflag == tar.TypeReg {
+				if _, err := io.Copy(tw, layerTr); err != nil {
+					return err
+				}
+			}
+		}
+		for d := range opaque {
+			deleted[d] = true
+		}
+	}
+
+	return nil
+}
+
+// diffIDOf returns the OCI diff ID (sha256 of the uncompressed layer
+// tarball) for the file at path.
+func diffIDOf(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeFlattenedImageTar writes a `docker load`-compatible tar at destPath
+// containing cfg as the image config, layerPath as its single layer, and a
+// manifest.json tagging the result as dstImage.
+func writeFlattenedImageTar(destPath, dstImage string, cfg ociImageConfig, layerPath string) error {
+	configBytes, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	configDigest := sha256.Sum256(configBytes)
+	configName := hex.EncodeToString(configDigest[:]) + ".json"
+
+	manifest := []ociManifestEntry{{
+		Config:   configName,
+		RepoTags: []string{dstImage},
+		Layers:   []string{"layer.tar"},
+	}}
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	tw := tar.NewWriter(out)
+	defer tw.Close()
+
+	if err := addTarFile(tw, configName, configBytes); err != nil {
+		return err
+	}
+	if err := addTarFile(tw, "manifest.json", manifestBytes); err != nil {
+		return err
+	}
+
+	layer, err := os.Open(layerPath)
+	if err != nil {
+		return err
+	}
+	defer layer.Close()
+
+	info, err := layer.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     "layer.tar",
+		Mode:     0644,
+		Size:     info.Size(),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, layer)
+	return err
+}
+
+func addTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, bytes.NewReader(data))
+	return err
+}
@@ -0,0 +1,218 @@
+package godocker
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildInnerLayerTar tars up the given name->content files into a single
+// layer tarball, the way `docker save` would for one image layer.
+func buildInnerLayerTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatalf("write header for %s: %v", name, err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("write content for %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close inner tar: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// buildSavedImageTar emulates the outer tar produced by `docker save`,
+// containing one entry per named layer tarball.
+func buildSavedImageTar(t *testing.T, layers map[string][]byte) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "godocker-image-test")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	savedPath := filepath.Join(dir, "saved.tar")
+	f, err := os.Create(savedPath)
+	if err != nil {
+		t.Fatalf("create saved.tar: %v", err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for name, content := range layers {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatalf("write header for %s: %v", name, err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatalf("write content for %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close saved.tar: %v", err)
+	}
+
+	return savedPath
+}
+
+func readTarEntries(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	entries := make(map[string]string)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read entry %s: %v", hdr.Name, err)
+		}
+		entries[hdr.Name] = string(data)
+	}
+	return entries
+}
+
+func TestFlattenLayersHonorsWhiteoutsAndOverwrites(t *testing.T) {
+	layer1 := buildInnerLayerTar(t, map[string]string{
+		"a.txt": "from layer1",
+		"b.txt": "layer1-b",
+	})
+	layer2 := buildInnerLayerTar(t, map[string]string{
+		"a.txt":     "from layer2",
+		"c.txt":     "layer2-c",
+		".wh.b.txt": "",
+	})
+
+	savedPath := buildSavedImageTar(t, map[string][]byte{
+		"layer1/layer.tar": layer1,
+		"layer2/layer.tar": layer2,
+	})
+
+	destPath := filepath.Join(filepath.Dir(savedPath), "flattened.tar")
+	diffID, err := flattenLayers(savedPath, []string{"layer1/layer.tar", "layer2/layer.tar"}, destPath)
+	if err != nil {
+		t.Fatalf("flattenLayers: %v", err)
+	}
+
+	entries := readTarEntries(t, destPath)
+
+	if got, want := entries["a.txt"], "from layer2"; got != want {
+		t.Errorf("a.txt = %q, want %q (newest layer should win)", got, want)
+	}
+	if got, want := entries["c.txt"], "layer2-c"; got != want {
+		t.Errorf("c.txt = %q, want %q", got, want)
+	}
+	if _, ok := entries["b.txt"]; ok {
+		t.Error("b.txt should have been removed by the whiteout in layer2")
+	}
+	if _, ok := entries[".wh.b.txt"]; ok {
+		t.Error("the whiteout marker itself should not appear in the flattened layer")
+	}
+
+	// diffID must be the sha256 of the flattened tar's bytes.
+	data, err := ioutil.ReadFile(destPath)
+	if err != nil {
+		t.Fatalf("read flattened tar: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	wantDiffID := "sha256:" + hex.EncodeToString(sum[:])
+	if diffID != wantDiffID {
+		t.Errorf("diffID = %q, want %q", diffID, wantDiffID)
+	}
+}
+
+func TestOCIImageConfigUnmarshalsRealisticHistory(t *testing.T) {
+	// A representative config.json as produced by `docker save`: history is
+	// an array of objects, not strings, and most entries are empty_layer
+	// markers with no matching rootfs.diff_ids entry.
+	configJSON := `{
+		"architecture": "amd64",
+		"os": "linux",
+		"config": {
+			"Env": ["PATH=/usr/bin"],
+			"Cmd": ["/bin/sh"],
+			"Labels": {"maintainer": "someone"}
+		},
+		"rootfs": {
+			"type": "layers",
+			"diff_ids": ["sha256:abc123"]
+		},
+		"history": [
+			{"created": "2020-01-01T00:00:00Z", "created_by": "/bin/sh -c #(nop) ADD file in /"},
+			{"created": "2020-01-02T00:00:00Z", "created_by": "/bin/sh -c #(nop) CMD [\"/bin/sh\"]", "empty_layer": true}
+		]
+	}`
+
+	var cfg ociImageConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		t.Fatalf("unmarshal realistic config: %v", err)
+	}
+
+	if len(cfg.History) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(cfg.History))
+	}
+	if cfg.Config.Labels["maintainer"] != "someone" {
+		t.Errorf("Labels = %v, want maintainer=someone preserved", cfg.Config.Labels)
+	}
+	if len(cfg.RootFS.DiffIDs) != 1 || cfg.RootFS.DiffIDs[0] != "sha256:abc123" {
+		t.Errorf("RootFS.DiffIDs = %v", cfg.RootFS.DiffIDs)
+	}
+}
+
+func TestDiffIDOf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godocker-diffid-test")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "layer.tar")
+	content := []byte("hello layer")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	got, err := diffIDOf(path)
+	if err != nil {
+		t.Fatalf("diffIDOf: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	want := "sha256:" + hex.EncodeToString(sum[:])
+	if got != want {
+		t.Errorf("diffIDOf = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,199 @@
+package godocker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/pkg/errors"
+)
+
+// ProgressEvent is a single decoded entry from the daemon's JSON progress
+// stream, emitted while a Build/Pull/Push is in flight.
+type ProgressEvent struct {
+	Stream          string
+	Status          string
+	ID              string
+	ProgressCurrent int64
+	ProgressTotal   int64
+	Aux             json.RawMessage
+}
+
+// decodeProgress reads newline-delimited jsonmessage.JSONMessage values from
+// in, forwarding each as a ProgressEvent on events, until the stream ends or
+// a message reports an error (that message is forwarded too). It then sends
+// exactly one value on errc - the daemon's error, a decode error, or nil at
+// end of stream - and closes events. errc must be buffered, so a caller that
+// drains events finds the value waiting on errc once events is closed.
+func decodeProgress(in io.Reader, events chan<- ProgressEvent, errc chan<- error) {
+	defer close(events)
+
+	dec := json.NewDecoder(in)
+	for {
+		var jm jsonmessage.JSONMessage
+		if err := dec.Decode(&jm); err != nil {
+			if err == io.EOF {
+				errc <- nil
+				return
+			}
+			errc <- err
+			return
+		}
+
+		evt := ProgressEvent{
+			Stream: jm.Stream,
+			Status: jm.Status,
+			ID:     jm.ID,
+			Aux:    jsonRawMessage(jm.Aux),
+		}
+		if jm.Progress != nil {
+			evt.ProgressCurrent = jm.Progress.Current
+			evt.ProgressTotal = jm.Progress.Total
+		}
+		events <- evt
+
+		if jm.Error != nil {
+			errc <- jm.Error
+			return
+		}
+		if len(jm.ErrorMessage) > 0 {
+			errc <- errors.New(jm.ErrorMessage)
+			return
+		}
+	}
+}
+
+func jsonRawMessage(aux *json.RawMessage) json.RawMessage {
+	if aux == nil {
+		return nil
+	}
+	return *aux
+}
+
+// DisplayProgress consumes events, writing a human-readable line per event to
+// w, the same way the docker CLI renders jsonmessage.DisplayJSONMessagesStream
+// output. It returns once events is closed.
+func DisplayProgress(events <-chan ProgressEvent, w io.Writer) {
+	for evt := range events {
+		switch {
+		case evt.Stream != "":
+			fmt.Fprint(w, evt.Stream)
+		case evt.ProgressTotal > 0:
+			fmt.Fprintf(w, "%s: %s (%d/%d)\n", evt.ID, evt.Status, evt.ProgressCurrent, evt.ProgressTotal)
+		case evt.Status != "":
+			if evt.ID != "" {
+				fmt.Fprintf(w, "%s: %s\n", evt.ID, evt.Status)
+			} else {
+				fmt.Fprintln(w, evt.Status)
+			}
+		}
+	}
+}
+
+// BuildWithProgress behaves like Build but streams the daemon's progress
+// messages back on the returned channel instead of only surfacing a terminal
+// error. The error channel receives exactly one value - the final build
+// error, or nil on success - once the events channel has been closed.
+//
+// It builds through the same docker.builder a plain Build call would, so
+// configuring Configs.Builder = "buildkit" affects this call site too. If
+// the configured backend doesn't support streaming progress (e.g. BuildKit's
+// solve progress isn't a jsonmessage stream), the build still runs via
+// docker.builder.Build and, if it reports an image ID, a single synthetic
+// event whose Aux holds that ID as {"ID": ...} is emitted before the channel
+// closes; no event carries the build's tags.
+func (docker *dockerCmd) BuildWithProgress(ctx context.Context, contextDirectory, imagePath string, args map[string]*string) (<-chan ProgressEvent, <-chan error, error) {
+	return docker.BuildExWithProgress(ctx, BuildRequest{
+		ContextDirectory: contextDirectory,
+		Dockerfile:       defaultDockerfile,
+		Tags:             []string{imagePath},
+		BuildArgs:        args,
+	})
+}
+
+// BuildExWithProgress is to BuildWithProgress what BuildEx is to Build - it
+// accepts a full BuildRequest so Target, Labels, CacheFrom, Secrets, SSH and
+// Platform reach whichever backend docker.builder is, the same as BuildEx.
+func (docker *dockerCmd) BuildExWithProgress(ctx context.Context, req BuildRequest) (<-chan ProgressEvent, <-chan error, error) {
+	if req.Dockerfile == "" {
+		req.Dockerfile = defaultDockerfile
+	}
+
+	if pb, ok := docker.builder.(progressBuilder); ok {
+		return pb.BuildWithProgress(ctx, req)
+	}
+
+	events := make(chan ProgressEvent)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(events)
+
+		result, err := docker.builder.Build(ctx, req)
+		if result.ImageID != "" {
+			auxBytes, marshalErr := json.Marshal(buildAux{ID: result.ImageID})
+			if marshalErr == nil {
+				events <- ProgressEvent{Aux: auxBytes}
+			}
+		}
+		errc <- err
+	}()
+
+	return events, errc, nil
+}
+
+// PullWithProgress behaves like Pull but streams the daemon's progress
+// messages back on the returned channel. See BuildWithProgress for the
+// error-channel contract.
+func (docker *dockerCmd) PullWithProgress(ctx context.Context, imagePath string) (<-chan ProgressEvent, <-chan error, error) {
+	pullOpts := types.ImagePullOptions{}
+	if auth, ok := docker.authResolver.Resolve(imagePath); ok {
+		if authBase64, err := encodeAuthBase64(auth); err == nil {
+			pullOpts.RegistryAuth = authBase64
+		}
+	}
+
+	resp, err := docker.cli.ImagePull(ctx, imagePath, pullOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan ProgressEvent)
+	errc := make(chan error, 1)
+	go func() {
+		defer resp.Close()
+		decodeProgress(resp, events, errc)
+	}()
+
+	return events, errc, nil
+}
+
+// PushWithProgress behaves like Push but streams the daemon's progress
+// messages back on the returned channel. See BuildWithProgress for the
+// error-channel contract.
+func (docker *dockerCmd) PushWithProgress(ctx context.Context, imagePath string) (<-chan ProgressEvent, <-chan error, error) {
+	pushOpts := types.ImagePushOptions{
+		RegistryAuth: docker.registryAuthString,
+	}
+	if auth, ok := docker.authResolver.Resolve(imagePath); ok {
+		if authBase64, err := encodeAuthBase64(auth); err == nil {
+			pushOpts.RegistryAuth = authBase64
+		}
+	}
+
+	resp, err := docker.cli.ImagePush(ctx, imagePath, pushOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan ProgressEvent)
+	errc := make(chan error, 1)
+	go func() {
+		defer resp.Close()
+		decodeProgress(resp, events, errc)
+	}()
+
+	return events, errc, nil
+}
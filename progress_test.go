@@ -0,0 +1,105 @@
+package godocker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func drainProgress(t *testing.T, in string) ([]ProgressEvent, error) {
+	t.Helper()
+
+	events := make(chan ProgressEvent)
+	errc := make(chan error, 1)
+	go decodeProgress(strings.NewReader(in), events, errc)
+
+	var got []ProgressEvent
+	for evt := range events {
+		got = append(got, evt)
+	}
+	return got, <-errc
+}
+
+func TestDecodeProgressStopsOnError(t *testing.T) {
+	stream := `{"status":"Pulling from library/ubuntu"}
+{"status":"Downloading","progressDetail":{"current":50,"total":100},"id":"abc123"}
+{"errorDetail":{"message":"pull access denied"},"error":"pull access denied"}
+`
+	events, err := drainProgress(t, stream)
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events (including the error message itself), got %d: %+v", len(events), events)
+	}
+	if events[1].ID != "abc123" || events[1].ProgressCurrent != 50 || events[1].ProgressTotal != 100 {
+		t.Fatalf("unexpected progress event: %+v", events[1])
+	}
+	if err == nil || err.Error() != "pull access denied" {
+		t.Fatalf("expected pull access denied error, got %v", err)
+	}
+}
+
+func TestDecodeProgressSuccess(t *testing.T) {
+	stream := `{"stream":"Step 1/2 : FROM ubuntu\n"}
+{"stream":"Step 2/2 : CMD [\"true\"]\n"}
+`
+	events, err := drainProgress(t, stream)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+}
+
+func TestDecodeBuildID(t *testing.T) {
+	stream := `{"stream":"Successfully built abc123\n"}
+{"aux":{"ID":"sha256:deadbeef"}}
+`
+	id, err := decodeBuildID(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "sha256:deadbeef" {
+		t.Fatalf("expected sha256:deadbeef, got %q", id)
+	}
+}
+
+func TestDecodeBuildIDPropagatesError(t *testing.T) {
+	stream := `{"errorDetail":{"message":"no such file"},"error":"no such file"}
+`
+	_, err := decodeBuildID(strings.NewReader(stream))
+	if err == nil || err.Error() != "no such file" {
+		t.Fatalf("expected \"no such file\" error, got %v", err)
+	}
+}
+
+func TestDecodePushResult(t *testing.T) {
+	stream := `{"status":"Pushing"}
+{"aux":{"Tag":"master","Digest":"sha256:cafebabe","Size":1234}}
+`
+	result, err := decodePushResult(strings.NewReader(stream), "myrepo/myimage:master")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Ref != "myrepo/myimage:master" || result.Digest != "sha256:cafebabe" || result.Size != 1234 {
+		t.Fatalf("unexpected push result: %+v", result)
+	}
+}
+
+func TestDisplayProgress(t *testing.T) {
+	events := make(chan ProgressEvent, 2)
+	events <- ProgressEvent{Stream: "Step 1/1 : FROM ubuntu\n"}
+	events <- ProgressEvent{ID: "layer1", Status: "Downloading", ProgressCurrent: 50, ProgressTotal: 100}
+	close(events)
+
+	var buf bytes.Buffer
+	DisplayProgress(events, &buf)
+
+	out := buf.String()
+	if !strings.Contains(out, "Step 1/1 : FROM ubuntu") {
+		t.Fatalf("expected stream output in %q", out)
+	}
+	if !strings.Contains(out, "layer1: Downloading (50/100)") {
+		t.Fatalf("expected progress line in %q", out)
+	}
+}
@@ -0,0 +1,130 @@
+// Package reference provides a small set of helpers for parsing and
+// manipulating docker image references, mirroring the subset of
+// github.com/docker/distribution/reference that godocker needs to turn a
+// Push result into a fully-qualified, pinnable reference.
+package reference
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultDomain is used as the registry host for references that don't
+// specify one, matching the docker CLI's treatment of Docker Hub.
+const DefaultDomain = "index.docker.io"
+
+// DefaultTag is appended to references with no explicit tag or digest.
+const DefaultTag = "latest"
+
+// Named is a parsed image reference, split into its registry/domain, path
+// and, if present, tag and digest.
+type Named struct {
+	domain string
+	path   string
+	tag    string
+	digest string
+}
+
+// ParseNamed parses s into a Named reference. A reference with no domain is
+// assumed to live on Docker Hub (DefaultDomain), exactly like the docker
+// daemon does when resolving short names such as "ubuntu:16.04".
+func ParseNamed(s string) (Named, error) {
+	if s == "" {
+		return Named{}, fmt.Errorf("reference: empty reference")
+	}
+
+	remainder := s
+	digest := ""
+	if i := strings.IndexByte(remainder, '@'); i != -1 {
+		digest = remainder[i+1:]
+		remainder = remainder[:i]
+	}
+
+	tag := ""
+	// A ':' after the last '/' separates a tag from the path; a ':' that
+	// appears as part of a host:port prefix does not.
+	lastSlash := strings.LastIndexByte(remainder, '/')
+	if i := strings.LastIndexByte(remainder, ':'); i != -1 && i > lastSlash {
+		tag = remainder[i+1:]
+		remainder = remainder[:i]
+	}
+
+	domain, path := splitDomain(remainder)
+	if path == "" {
+		return Named{}, fmt.Errorf("reference: invalid reference %q", s)
+	}
+
+	return Named{domain: domain, path: path, tag: tag, digest: digest}, nil
+}
+
+// officialRepoPrefix is prepended to single-segment Docker Hub repository
+// names - "ubuntu" is shorthand for "library/ubuntu", exactly as the docker
+// daemon and github.com/docker/distribution/reference expand it.
+const officialRepoPrefix = "library/"
+
+// splitDomain separates the leading registry host from the repository path,
+// defaulting to DefaultDomain when remainder has no host component (no '.',
+// ':' or "localhost" before the first '/'). A bare, single-segment name on
+// the default domain (e.g. "ubuntu") is expanded to the official repository
+// path ("library/ubuntu"); a name that already carries a namespace (e.g.
+// "myuser/myimage") is left alone.
+func splitDomain(remainder string) (domain, path string) {
+	i := strings.IndexByte(remainder, '/')
+	if i == -1 {
+		return DefaultDomain, officialRepoPrefix + remainder
+	}
+
+	candidate := remainder[:i]
+	if !strings.ContainsAny(candidate, ".:") && candidate != "localhost" {
+		return DefaultDomain, remainder
+	}
+
+	return candidate, remainder[i+1:]
+}
+
+// Domain returns the registry host of ref.
+func Domain(ref Named) string {
+	return ref.domain
+}
+
+// Path returns the repository path of ref, without domain, tag or digest.
+func Path(ref Named) string {
+	return ref.path
+}
+
+// IsNameOnly reports whether ref has neither a tag nor a digest.
+func IsNameOnly(ref Named) bool {
+	return ref.tag == "" && ref.digest == ""
+}
+
+// WithDefaultTag returns ref with DefaultTag applied if it has no tag and no
+// digest already.
+func WithDefaultTag(ref Named) Named {
+	if !IsNameOnly(ref) {
+		return ref
+	}
+	ref.tag = DefaultTag
+	return ref
+}
+
+// WithDigest returns a copy of ref pinned to digest, dropping any tag - the
+// same normalization the docker CLI applies when resolving a name@digest
+// reference for a pull or deploy.
+func WithDigest(ref Named, digest string) Named {
+	ref.tag = ""
+	ref.digest = digest
+	return ref
+}
+
+// String renders ref back into docker's canonical reference syntax,
+// domain/path[:tag][@digest].
+func (ref Named) String() string {
+	s := ref.domain + "/" + ref.path
+	if ref.tag != "" {
+		s += ":" + ref.tag
+	}
+	if ref.digest != "" {
+		s += "@" + ref.digest
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package reference
+
+import "testing"
+
+func TestParseNamedAndString(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"ubuntu:16.04", "index.docker.io/library/ubuntu:16.04"},
+		{"ubuntu", "index.docker.io/library/ubuntu"},
+		{"myuser/myimage:latest", "index.docker.io/myuser/myimage:latest"},
+		{"registry.example.com/myimage:v1", "registry.example.com/myimage:v1"},
+		{"registry.example.com:5000/myimage", "registry.example.com:5000/myimage"},
+		{"localhost/myimage", "localhost/myimage"},
+		{"gcr.io/project/image@sha256:abcd", "gcr.io/project/image@sha256:abcd"},
+	}
+
+	for _, c := range cases {
+		ref, err := ParseNamed(c.in)
+		if err != nil {
+			t.Fatalf("ParseNamed(%q) returned error: %v", c.in, err)
+		}
+		if got := ref.String(); got != c.want {
+			t.Errorf("ParseNamed(%q).String() = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseNamedInvalid(t *testing.T) {
+	if _, err := ParseNamed(""); err == nil {
+		t.Fatal("expected an error for an empty reference")
+	}
+}
+
+func TestDomainAndPath(t *testing.T) {
+	ref, err := ParseNamed("ubuntu:16.04")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if Domain(ref) != DefaultDomain {
+		t.Errorf("Domain() = %q, want %q", Domain(ref), DefaultDomain)
+	}
+	if Path(ref) != "library/ubuntu" {
+		t.Errorf("Path() = %q, want %q", Path(ref), "library/ubuntu")
+	}
+}
+
+func TestIsNameOnlyAndWithDefaultTag(t *testing.T) {
+	ref, err := ParseNamed("ubuntu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsNameOnly(ref) {
+		t.Fatal("expected a tagless, digestless reference to be name-only")
+	}
+
+	tagged := WithDefaultTag(ref)
+	if IsNameOnly(tagged) {
+		t.Fatal("expected WithDefaultTag to produce a tagged reference")
+	}
+	if tagged.String() != "index.docker.io/library/ubuntu:latest" {
+		t.Errorf("WithDefaultTag(...).String() = %q", tagged.String())
+	}
+}
+
+func TestWithDigest(t *testing.T) {
+	ref, err := ParseNamed("myuser/myimage:v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pinned := WithDigest(ref, "sha256:cafebabe")
+	want := "index.docker.io/myuser/myimage@sha256:cafebabe"
+	if pinned.String() != want {
+		t.Errorf("WithDigest(...).String() = %q, want %q", pinned.String(), want)
+	}
+}